@@ -11,50 +11,365 @@ package github
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/google/go-github/v66/github"
+	"github.com/gregjones/httpcache"
+	"github.com/gregjones/httpcache/diskcache"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 )
 
-type PGGetAllTeamsResponse struct {
-	teams []*github.Team
-	resp  *github.Response
-	err   error
-}
-
-type PGGetAllTeamReposResponse struct {
-	repos []*github.Repository
-	resp  *github.Response
-	err   error
-}
+// pgDefaultBulkFetchConcurrency bounds how many requests each of a
+// ResourceCache's bulk-fetch worker pools runs at once, so warming the cache
+// for an org with hundreds of teams doesn't open hundreds of simultaneous
+// connections. The limit applies per pool, not across the whole cache: in
+// WarmTeamRepos each team's own page fan-out runs its own pool inside the
+// per-team pool.
+const pgDefaultBulkFetchConcurrency = 8
 
 // Constants
+// These are kept as the default org for the pg* helper functions below, which
+// predate multi-org support. New code should go through ResourceCache directly
+// and pass the org it cares about instead of relying on this default.
 var pgGithubOrgName string = "propertyguru"
 var pgGithubOrgId int64 = 1661612
 
-// This contains the response of API call to get all the teams
-var pgGetAllTeamsResponse PGGetAllTeamsResponse
+// teamRepoEntry is the per-team repo cache entry. Every field here was
+// captured from the single request that populated it, so a lookup for teamID
+// can never observe the response or error from a different team's fetch -
+// unlike the old pgGetAllTeamReposResponse package global, which every team's
+// goroutine overwrote.
+type teamRepoEntry struct {
+	mu          sync.Mutex
+	done        bool
+	fetchedAt   time.Time
+	reposByName map[string]*github.Repository
+	resp        *github.Response
+	err         error
+}
+
+// teamMemberEntry is teamRepoEntry's equivalent for a team's membership list.
+type teamMemberEntry struct {
+	mu            sync.Mutex
+	done          bool
+	membersByName map[string]*github.User
+	resp          *github.Response
+	err           error
+}
+
+// orgCache holds everything bulk-fetched for a single organization: teams,
+// team repositories, members and team memberships. Each resource kind gets
+// its own "done" flag and mutex, so warming up (say) the team-repos cache for
+// one team never blocks a concurrent lookup of members in the same org.
+type orgCache struct {
+	orgLogin string
+	orgID    int64
+
+	// Teams
+	teamsMu        sync.Mutex
+	teamsDone      bool
+	teamsFetchedAt time.Time
+	teamsResp      *github.Response
+	teamsErr       error
+	teamsByID      map[int64]*github.Team
+	teamsBySlug    map[string]*github.Team
+
+	// Team repositories, keyed by team ID. teamRepos is a sync.Map of
+	// teamID -> *teamRepoEntry: lookups for different teams happen
+	// concurrently, but each entry's own mu makes sure only one goroutine
+	// populates it, and every field on it was captured from that goroutine's
+	// own request (see teamRepoEntry).
+	teamRepos sync.Map
+
+	// Org members
+	membersMu      sync.Mutex
+	membersDone    bool
+	membersResp    *github.Response
+	membersErr     error
+	membersByLogin map[string]*github.User
+
+	// Team memberships, keyed by team ID. Same per-entry shape as teamRepos.
+	teamMembers sync.Map
+}
+
+func newOrgCache(login string, id int64) *orgCache {
+	return &orgCache{
+		orgLogin:       login,
+		orgID:          id,
+		teamsByID:      make(map[int64]*github.Team),
+		teamsBySlug:    make(map[string]*github.Team),
+		membersByLogin: make(map[string]*github.User),
+	}
+}
+
+// teamRepoEntry returns (creating if necessary) the per-team repo entry for
+// teamID. It does not require the team to already be known from a teams
+// list fetch; an entry is created lazily on first access.
+func (oc *orgCache) teamRepoEntry(teamID int64) *teamRepoEntry {
+	actual, _ := oc.teamRepos.LoadOrStore(teamID, &teamRepoEntry{})
+	return actual.(*teamRepoEntry)
+}
+
+// teamMemberEntry is teamRepoEntry's sibling for team membership entries.
+func (oc *orgCache) teamMemberEntry(teamID int64) *teamMemberEntry {
+	actual, _ := oc.teamMembers.LoadOrStore(teamID, &teamMemberEntry{})
+	return actual.(*teamMemberEntry)
+}
+
+// ResourceCache is a provider-wide, multi-org bulk cache for GitHub teams,
+// repositories, members and team memberships. It generalizes the pg* globals
+// this file used to hardcode against a single org into something that can be
+// registered once on the provider Owner and shared by every resource that
+// would otherwise issue its own paginated API calls per-plan.
+//
+// Organizations are tracked by both login and numeric ID, the way maintner
+// keys GitHub objects by GitHub/GitHubRepoID: Terraform config addresses orgs
+// by login, but some GitHub endpoints (e.g. ListTeamReposByID) require the
+// numeric ID, so both need to resolve to the same underlying orgCache.
+type ResourceCache struct {
+	mu         sync.Mutex
+	byOrgLogin map[string]*orgCache
+	byOrgID    map[int64]*orgCache
+
+	// concurrency bounds the worker pool used to fan out paginated bulk-fetch
+	// requests (e.g. pages 2..N of a team list, or per-team repo listings).
+	concurrency int
+	// limiter is shared across every bulk-fetch request this cache issues, so
+	// the fan-out above stays within the provider's overall rate budget.
+	limiter *rate.Limiter
+
+	// HTTPCacheDir, if set, persists the conditional-request (ETag) cache to
+	// this directory on disk instead of keeping it in memory, so successive
+	// `terraform plan` processes against an unchanged org reuse 304 responses
+	// from the previous run. Set before the first call to NewCachedHTTPClient.
+	HTTPCacheDir string
+
+	// cacheConfig controls TTL-based invalidation and the background refresh
+	// loop started by StartBackgroundRefresh. The zero value (TTL 0) keeps
+	// the original once-per-process behavior: a resource kind, once fetched,
+	// is never considered stale.
+	cacheConfig CacheConfig
+}
+
+// CacheConfig controls how long bulk-fetched data stays fresh before it's
+// re-listed from GitHub, for long-lived callers of ResourceCache (e.g. the
+// provider running under terraform-plugin-framework server mode, or a CDKTF
+// daemon) where a single short-lived `terraform apply` process-lifetime
+// cache isn't appropriate.
+type CacheConfig struct {
+	// TTL is how long the teams list and each team's repo list stay valid
+	// once fetched. Zero (the default) means "never expire", matching the
+	// original behavior of this cache. Org members and team memberships do
+	// not expire: once fetched they are kept for the life of the cache,
+	// whatever the TTL.
+	TTL time.Duration
+	// SyncInterval is how often the background refresh goroutine started by
+	// StartBackgroundRefresh re-lists every org it has seen so far. It only
+	// has an effect when TTL is non-zero; it defaults to TTL itself.
+	SyncInterval time.Duration
+}
+
+// SetCacheConfig installs cfg as this cache's TTL/refresh configuration.
+func (c *ResourceCache) SetCacheConfig(cfg CacheConfig) {
+	c.cacheConfig = cfg
+}
+
+// expired reports whether fetchedAt is stale under the configured TTL. With
+// the default TTL of 0, nothing is ever considered expired.
+func (c *ResourceCache) expired(fetchedAt time.Time) bool {
+	return c.cacheConfig.TTL > 0 && time.Since(fetchedAt) > c.cacheConfig.TTL
+}
+
+// StartBackgroundRefresh spawns a goroutine that re-lists teams (and
+// invalidates team-repo caches, which are re-fetched lazily on next access)
+// for every org this cache has seen so far, once per SyncInterval, until ctx
+// is done. It's a no-op when TTL is 0 (the default, "never expire" mode),
+// since there would be nothing for it to invalidate.
+func (c *ResourceCache) StartBackgroundRefresh(ctx context.Context, client *github.Client) {
+	if c.cacheConfig.TTL <= 0 {
+		return
+	}
+	interval := c.cacheConfig.SyncInterval
+	if interval <= 0 {
+		interval = c.cacheConfig.TTL
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.refreshAllOrgs(ctx, client)
+			}
+		}
+	}()
+}
+
+func (c *ResourceCache) refreshAllOrgs(ctx context.Context, client *github.Client) {
+	c.mu.Lock()
+	orgs := make([]*orgCache, 0, len(c.byOrgLogin))
+	for _, oc := range c.byOrgLogin {
+		orgs = append(orgs, oc)
+	}
+	c.mu.Unlock()
+
+	for _, oc := range orgs {
+		// Best-effort: a transient refresh failure leaves the previous data
+		// in place, it doesn't evict it.
+		_ = c.ForceRefresh(ctx, client, oc.orgLogin, oc.orgID)
+	}
+}
+
+// ForceRefresh invalidates orgLogin/orgID's team cache, re-lists it
+// immediately, and marks every team's repo cache stale so it's re-fetched
+// lazily on next access, regardless of TTL. This is the invalidate-on-demand
+// primitive a provider-level "force_refresh" function/data source would call;
+// no such function or data source exists in this repo yet (there is no
+// provider.go in this tree to register one against), so for now ForceRefresh
+// is only reachable from Go code, e.g. tests or a future provider wiring.
+func (c *ResourceCache) ForceRefresh(ctx context.Context, client *github.Client, orgLogin string, orgID int64) error {
+	oc := c.forOrg(orgLogin, orgID)
+
+	oc.teamsMu.Lock()
+	oc.teamsDone = false
+	teamIDs := make([]int64, 0, len(oc.teamsByID))
+	for id := range oc.teamsByID {
+		teamIDs = append(teamIDs, id)
+	}
+	oc.teamsMu.Unlock()
+
+	if err := pgInitializeLocalDataTeams(ctx, client, c, oc); err != nil {
+		return err
+	}
+
+	for _, id := range teamIDs {
+		entry := oc.teamRepoEntry(id)
+		entry.mu.Lock()
+		entry.done = false
+		entry.mu.Unlock()
+	}
+	return nil
+}
+
+// NewResourceCache returns an empty cache ready to be registered on a
+// provider Owner. It defaults to pgDefaultBulkFetchConcurrency workers and no
+// rate limiting; call SetConcurrency/SetRateLimiter to override either.
+func NewResourceCache() *ResourceCache {
+	return &ResourceCache{
+		byOrgLogin:  make(map[string]*orgCache),
+		byOrgID:     make(map[int64]*orgCache),
+		concurrency: pgDefaultBulkFetchConcurrency,
+		limiter:     rate.NewLimiter(rate.Inf, 0),
+	}
+}
+
+// SetConcurrency overrides the default bounded worker pool size (8) used when
+// fanning out paginated bulk-fetch requests.
+func (c *ResourceCache) SetConcurrency(n int) {
+	if n > 0 {
+		c.concurrency = n
+	}
+}
+
+// SetRateLimiter installs a shared rate limiter that every bulk-fetch request
+// issued by this cache waits on before hitting the GitHub API.
+func (c *ResourceCache) SetRateLimiter(l *rate.Limiter) {
+	if l != nil {
+		c.limiter = l
+	}
+}
+
+// NewCachedHTTPClient returns an *http.Client that performs conditional GETs
+// (ETag / If-None-Match) against the GitHub API through httpcache, so a
+// listing page that hasn't changed since the last plan costs GitHub a 304
+// instead of a full response against the primary rate limit. The cache is
+// in-memory unless c.HTTPCacheDir is set, in which case it's persisted to
+// disk and survives across separate `terraform plan` processes. base, if
+// non-nil, is used as the underlying transport (e.g. one that already
+// injects an auth token); it defaults to http.DefaultTransport.
+func (c *ResourceCache) NewCachedHTTPClient(base http.RoundTripper) *http.Client {
+	var cache httpcache.Cache
+	if c.HTTPCacheDir != "" {
+		cache = diskcache.New(c.HTTPCacheDir)
+	} else {
+		cache = httpcache.NewMemoryCache()
+	}
+	t := &httpcache.Transport{Cache: cache, MarkCachedResponses: true}
+	if base != nil {
+		t.Transport = base
+	}
+	return t.Client()
+}
+
+// rateLimitedDo waits on the cache's rate limiter and runs fn. If fn fails
+// with a primary or secondary (abuse) rate limit error, it backs off for the
+// duration GitHub asked for and retries exactly once.
+func (c *ResourceCache) rateLimitedDo(ctx context.Context, fn func() (*github.Response, error)) (*github.Response, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	resp, err := fn()
+	if delay, retryable := pgRateLimitBackoff(err); retryable {
+		time.Sleep(delay)
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		resp, err = fn()
+	}
+	return resp, err
+}
+
+// pgRateLimitBackoff inspects err for a primary (*github.RateLimitError) or
+// secondary (*github.AbuseRateLimitError) GitHub rate limit error and, if
+// found, returns how long to back off before retrying.
+func pgRateLimitBackoff(err error) (time.Duration, bool) {
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return time.Until(rateLimitErr.Rate.Reset.Time), true
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if abuseErr.RetryAfter != nil {
+			return *abuseErr.RetryAfter, true
+		}
+		return time.Minute, true
+	}
+	return 0, false
+}
 
-// This contains the response of API call to get all the repositories in a team
-var pgGetAllTeamReposResponse PGGetAllTeamReposResponse
+// forOrg returns the per-org cache for the given login/ID pair, creating it
+// on first use. Both are required up front: whichever one a caller knows
+// about is used to find (or seed) the other.
+func (c *ResourceCache) forOrg(login string, id int64) *orgCache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-// This is the map of team ID or team slug to the team object
-// We just use normal Map, not a Sync Map, because the writes to it are only done by one thread, and the other threads
-// waits until the write operation complete. Thus, no race condition possible.
-var pgTeamsByTeamId = make(map[int64]*github.Team)
-var pgTeamsByTeamSlug = make(map[string]*github.Team)
+	if oc, ok := c.byOrgLogin[login]; ok {
+		return oc
+	}
+	if oc, ok := c.byOrgID[id]; ok {
+		c.byOrgLogin[login] = oc
+		return oc
+	}
 
-// This is the map of team ID and repository name to the repository object
-// A nested map where the first key is the team ID and the second key is the repository name
-// Using sync.Map because the writes to it are done by many threads, and the reads can happen between those writes
-var pgReposByTeamIdAndRepoName sync.Map
+	oc := newOrgCache(login, id)
+	c.byOrgLogin[login] = oc
+	c.byOrgID[id] = oc
+	return oc
+}
 
-// Mutexes
-var pgMutexInitializeLocalDataTeams sync.Mutex
-var pgDoneGetAllTeams bool = false
-var pgMutexInitializeLocalDataTeamRepos = make(map[int64]*sync.Mutex)
-var pgDoneGetAllTeamRepos = make(map[int64]bool)
+// pgResourceCache is the process-wide cache instance backing the pg* helper
+// functions below, until their callers are updated to pull a provider-scoped
+// instance off Owner instead. Keeping a single shared instance here preserves
+// the process-lifetime caching behavior those helpers already had.
+var pgResourceCache = NewResourceCache()
 
 /**********************/
 /* INTERNAL FUNCTIONS */
@@ -62,111 +377,422 @@ var pgDoneGetAllTeamRepos = make(map[int64]bool)
 // The functions below should be only called from this file only
 // as part of the operations in getting the resources in bulk from calling GitHub API
 
-func pgInitializeLocalDataTeams(ctx context.Context, client *github.Client) error {
+func pgInitializeLocalDataTeams(ctx context.Context, client *github.Client, c *ResourceCache, oc *orgCache) error {
 	// Let only one thread get all teams from GitHub
 	// If one thread is already starting to get all teams, let the other threads wait until the work is done
-	pgMutexInitializeLocalDataTeams.Lock()
-	if !pgDoneGetAllTeams {
-		page := 1
-		for {
-			opts := github.ListOptions{PerPage: 100, Page: page}
-			teams, resp, err := client.Teams.ListTeams(ctx, pgGithubOrgName, &opts)
-			pgGetAllTeamsResponse = PGGetAllTeamsResponse{teams, resp, err}
+	oc.teamsMu.Lock()
+	defer oc.teamsMu.Unlock()
+	if oc.teamsDone && !c.expired(oc.teamsFetchedAt) {
+		return oc.teamsErr
+	}
 
-			if pgGetAllTeamsResponse.err != nil {
-				return pgGetAllTeamsResponse.err
-			}
+	fetchPage := func(page int) ([]*github.Team, *github.Response, error) {
+		var teams []*github.Team
+		opts := github.ListOptions{PerPage: 100, Page: page}
+		resp, err := c.rateLimitedDo(ctx, func() (*github.Response, error) {
+			var resp *github.Response
+			var err error
+			teams, resp, err = client.Teams.ListTeams(ctx, oc.orgLogin, &opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, resp, err
+		}
+		return teams, resp, nil
+	}
 
-			for _, team := range pgGetAllTeamsResponse.teams {
-				pgTeamsByTeamId[team.GetID()] = team
-				pgTeamsByTeamSlug[team.GetSlug()] = team
-				pgMutexInitializeLocalDataTeamRepos[team.GetID()] = &sync.Mutex{}
-				pgDoneGetAllTeamRepos[team.GetID()] = false
-			}
+	// Page 1 tells us how many pages there are in total (via resp.LastPage),
+	// so it has to be fetched before the rest can be fanned out.
+	page1, resp, err := fetchPage(1)
+	if err != nil {
+		oc.teamsResp, oc.teamsErr = resp, err
+		return err
+	}
 
-			if len(pgGetAllTeamsResponse.teams) < 100 {
-				break
+	// Each page's teams and response are written to their own slice index, not
+	// to a shared oc.teamsResp/oc.teamsErr - concurrent writes to a single
+	// shared field from every page's goroutine would themselves be a data
+	// race, the same class of bug this cache used to have at the org level.
+	pagedTeams := [][]*github.Team{page1}
+	pagedResps := []*github.Response{resp}
+	switch {
+	case resp.LastPage > 1:
+		// GitHub told us the total page count via Link: rel="last", so the
+		// rest can be fanned out across the worker pool.
+		pagedTeams = append(pagedTeams, make([][]*github.Team, resp.LastPage-1)...)
+		pagedResps = append(pagedResps, make([]*github.Response, resp.LastPage-1)...)
+		g, _ := errgroup.WithContext(ctx)
+		g.SetLimit(c.concurrency)
+		for page := 2; page <= resp.LastPage; page++ {
+			page := page
+			g.Go(func() error {
+				teams, resp, err := fetchPage(page)
+				if err != nil {
+					return err
+				}
+				pagedTeams[page-1] = teams
+				pagedResps[page-1] = resp
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			oc.teamsErr = err
+			return err
+		}
+	case resp.NextPage != 0:
+		// GitHub omitted Link: rel="last" (only rel="next"), so the total page
+		// count is unknown up front and can't be fanned out. Fall back to
+		// walking pages sequentially via NextPage, like the original
+		// len(page) < 100 loop this replaced.
+		for page := resp.NextPage; page != 0; {
+			teams, pageResp, err := fetchPage(page)
+			if err != nil {
+				oc.teamsErr = err
+				return err
 			}
-			page++
+			pagedTeams = append(pagedTeams, teams)
+			pagedResps = append(pagedResps, pageResp)
+			page = pageResp.NextPage
+		}
+	}
+	oc.teamsResp, oc.teamsErr = pagedResps[len(pagedResps)-1], nil
+
+	// Build the new indexes off to the side and swap them in only once fully
+	// populated, so a refresh (TTL expiry) never leaves readers observing a
+	// partially-rebuilt map.
+	newByID := make(map[int64]*github.Team, len(oc.teamsByID))
+	newBySlug := make(map[string]*github.Team, len(oc.teamsBySlug))
+	for _, teams := range pagedTeams {
+		for _, team := range teams {
+			newByID[team.GetID()] = team
+			newBySlug[team.GetSlug()] = team
 		}
-		pgDoneGetAllTeams = true
 	}
-	pgMutexInitializeLocalDataTeams.Unlock()
-	return pgGetAllTeamsResponse.err
+	oc.teamsByID = newByID
+	oc.teamsBySlug = newBySlug
+	oc.teamsDone = true
+	oc.teamsFetchedAt = time.Now()
+	return nil
 }
 
-func pgInitializeLocalDataTeamRepos(ctx context.Context, client *github.Client, teamID int64) error {
+func pgInitializeLocalDataTeamRepos(ctx context.Context, client *github.Client, c *ResourceCache, oc *orgCache, teamID int64) error {
+	entry := oc.teamRepoEntry(teamID)
+
 	// Let only one thread get all repositories in a team from GitHub
 	// If one thread is already starting to get all repositories in a team, let the other threads wait until the work is done
-	pgMutexInitializeLocalDataTeamRepos[teamID].Lock()
-	if !pgDoneGetAllTeamRepos[teamID] {
-		mapRepoNameToRepo := make(map[string]*github.Repository)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.done && !c.expired(entry.fetchedAt) {
+		return entry.err
+	}
+
+	fetchPage := func(page int) ([]*github.Repository, *github.Response, error) {
+		var repos []*github.Repository
+		opts := github.ListOptions{PerPage: 100, Page: page}
+		resp, err := c.rateLimitedDo(ctx, func() (*github.Response, error) {
+			var resp *github.Response
+			var err error
+			repos, resp, err = client.Teams.ListTeamReposByID(ctx, oc.orgID, teamID, &opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, resp, err
+		}
+		return repos, resp, nil
+	}
+
+	page1, resp, err := fetchPage(1)
+	if err != nil {
+		entry.resp, entry.err = resp, err
+		return err
+	}
+
+	// Same reasoning as pgInitializeLocalDataTeams: each page's result goes to
+	// its own slice index instead of a field every goroutine would share.
+	pagedRepos := [][]*github.Repository{page1}
+	pagedResps := []*github.Response{resp}
+	switch {
+	case resp.LastPage > 1:
+		// GitHub told us the total page count via Link: rel="last", so the
+		// rest can be fanned out across the worker pool.
+		pagedRepos = append(pagedRepos, make([][]*github.Repository, resp.LastPage-1)...)
+		pagedResps = append(pagedResps, make([]*github.Response, resp.LastPage-1)...)
+		g, _ := errgroup.WithContext(ctx)
+		g.SetLimit(c.concurrency)
+		for page := 2; page <= resp.LastPage; page++ {
+			page := page
+			g.Go(func() error {
+				repos, resp, err := fetchPage(page)
+				if err != nil {
+					return err
+				}
+				pagedRepos[page-1] = repos
+				pagedResps[page-1] = resp
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			entry.err = err
+			return err
+		}
+	case resp.NextPage != 0:
+		// GitHub omitted Link: rel="last" (only rel="next"), so the total page
+		// count is unknown up front and can't be fanned out. Fall back to
+		// walking pages sequentially via NextPage, like the original
+		// len(page) < 100 loop this replaced.
+		for page := resp.NextPage; page != 0; {
+			repos, pageResp, err := fetchPage(page)
+			if err != nil {
+				entry.err = err
+				return err
+			}
+			pagedRepos = append(pagedRepos, repos)
+			pagedResps = append(pagedResps, pageResp)
+			page = pageResp.NextPage
+		}
+	}
+
+	mapRepoNameToRepo := make(map[string]*github.Repository)
+	for _, repos := range pagedRepos {
+		for _, repo := range repos {
+			mapRepoNameToRepo[repo.GetName()] = repo
+		}
+	}
+	entry.reposByName = mapRepoNameToRepo
+	entry.resp, entry.err = pagedResps[len(pagedResps)-1], nil
+	entry.done = true
+	entry.fetchedAt = time.Now()
+	return nil
+}
+
+// WarmTeamRepos bulk-fetches every team's repos in orgLogin/orgID up front,
+// fanning the per-team fetches out across the cache's bounded worker pool
+// instead of leaving them to the lazy, one-team-at-a-time fetch that
+// GetRepoByTeamIDAndRepoName otherwise does on first access.
+func (c *ResourceCache) WarmTeamRepos(ctx context.Context, client *github.Client, orgLogin string, orgID int64) error {
+	oc := c.forOrg(orgLogin, orgID)
+	if err := pgInitializeLocalDataTeams(ctx, client, c, oc); err != nil {
+		return err
+	}
+
+	teamIDs := make([]int64, 0, len(oc.teamsByID))
+	for id := range oc.teamsByID {
+		teamIDs = append(teamIDs, id)
+	}
+
+	g, _ := errgroup.WithContext(ctx)
+	g.SetLimit(c.concurrency)
+	for _, id := range teamIDs {
+		id := id
+		g.Go(func() error {
+			return pgInitializeLocalDataTeamRepos(ctx, client, c, oc, id)
+		})
+	}
+	return g.Wait()
+}
+
+func pgInitializeLocalDataMembers(ctx context.Context, client *github.Client, c *ResourceCache, oc *orgCache) error {
+	oc.membersMu.Lock()
+	defer oc.membersMu.Unlock()
+	if !oc.membersDone {
 		page := 1
 		for {
-			opts := github.ListOptions{PerPage: 100, Page: page}
-			repos, resp, err := client.Teams.ListTeamReposByID(ctx, pgGithubOrgId, teamID, &opts)
-			pgGetAllTeamReposResponse = PGGetAllTeamReposResponse{repos, resp, err}
+			opts := github.ListMembersOptions{ListOptions: github.ListOptions{PerPage: 100, Page: page}}
+			var members []*github.User
+			resp, err := c.rateLimitedDo(ctx, func() (*github.Response, error) {
+				var resp *github.Response
+				var err error
+				members, resp, err = client.Organizations.ListMembers(ctx, oc.orgLogin, &opts)
+				return resp, err
+			})
+			oc.membersResp, oc.membersErr = resp, err
 
-			if pgGetAllTeamReposResponse.err != nil {
-				return pgGetAllTeamReposResponse.err
+			if oc.membersErr != nil {
+				return oc.membersErr
 			}
 
-			for _, repo := range pgGetAllTeamReposResponse.repos {
-				mapRepoNameToRepo[repo.GetName()] = repo
+			for _, member := range members {
+				oc.membersByLogin[member.GetLogin()] = member
 			}
 
-			if len(pgGetAllTeamReposResponse.repos) < 100 {
+			if len(members) < 100 {
 				break
 			}
 			page++
 		}
-		pgReposByTeamIdAndRepoName.Store(teamID, mapRepoNameToRepo)
-		pgDoneGetAllTeamRepos[teamID] = true
+		oc.membersDone = true
 	}
-	pgMutexInitializeLocalDataTeamRepos[teamID].Unlock()
-	return pgGetAllTeamReposResponse.err
+	return oc.membersErr
+}
+
+func pgInitializeLocalDataTeamMembers(ctx context.Context, client *github.Client, c *ResourceCache, oc *orgCache, teamID int64) error {
+	entry := oc.teamMemberEntry(teamID)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.done {
+		return entry.err
+	}
+
+	mapLoginToMember := make(map[string]*github.User)
+	page := 1
+	for {
+		opts := github.TeamListTeamMembersOptions{ListOptions: github.ListOptions{PerPage: 100, Page: page}}
+		var members []*github.User
+		resp, err := c.rateLimitedDo(ctx, func() (*github.Response, error) {
+			var resp *github.Response
+			var err error
+			members, resp, err = client.Teams.ListTeamMembersByID(ctx, oc.orgID, teamID, &opts)
+			return resp, err
+		})
+		entry.resp, entry.err = resp, err
+
+		if entry.err != nil {
+			return entry.err
+		}
+
+		for _, member := range members {
+			mapLoginToMember[member.GetLogin()] = member
+		}
+
+		if len(members) < 100 {
+			break
+		}
+		page++
+	}
+	entry.membersByName = mapLoginToMember
+	entry.done = true
+	return nil
 }
 
 /**********************/
 /* EXTERNAL FUNCTIONS */
 /**********************/
-// The functions below are to be called from other files
-// For example, "pgGetTeamByTeamId" is called from file resource_github_team.go
+// The functions below are meant to be called from other files, either through
+// the ResourceCache methods directly or (for the default single-org process
+// cache) through the pg* wrapper functions further below - e.g. "pgGetTeamByTeamId"
+// is meant to be called from resource_github_team.go. As of this change none
+// of those resource files call into ResourceCache yet; that wiring is a
+// separate follow-up, so every exported method and pg* wrapper here is
+// currently unreferenced outside this file and its test.
 
-func pgGetTeamByTeamId(ctx context.Context, client *github.Client, id int64) (*github.Team, *github.Response, error) {
-	pgInitializeLocalDataTeams(ctx, client)
-	if team, teamFound := pgTeamsByTeamId[id]; teamFound {
-		return team, pgGetAllTeamsResponse.resp, pgGetAllTeamsResponse.err
+// GetTeamByID bulk-fetches (and caches) every team in orgLogin/orgID, then
+// returns the one matching id.
+func (c *ResourceCache) GetTeamByID(ctx context.Context, client *github.Client, orgLogin string, orgID, id int64) (*github.Team, *github.Response, error) {
+	oc := c.forOrg(orgLogin, orgID)
+	pgInitializeLocalDataTeams(ctx, client, c, oc)
+
+	// oc.teamsMu guards the lookup, not just the fetch: with TTL/background
+	// refresh (or ForceRefresh) in play, pgInitializeLocalDataTeams can be
+	// rewriting oc.teamsByID/oc.teamsResp/oc.teamsErr for a concurrent caller
+	// at the same moment this one reads them.
+	oc.teamsMu.Lock()
+	defer oc.teamsMu.Unlock()
+	if team, ok := oc.teamsByID[id]; ok {
+		return team, oc.teamsResp, oc.teamsErr
 	}
-	err := pgGetAllTeamsResponse.err
-	if err == nil {
-		err = &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}}
+	return nil, oc.teamsResp, notFoundOr(oc.teamsErr)
+}
+
+// GetTeamBySlug is GetTeamByID, but looked up by team slug instead of ID.
+func (c *ResourceCache) GetTeamBySlug(ctx context.Context, client *github.Client, orgLogin string, orgID int64, slug string) (*github.Team, *github.Response, error) {
+	oc := c.forOrg(orgLogin, orgID)
+	pgInitializeLocalDataTeams(ctx, client, c, oc)
+
+	oc.teamsMu.Lock()
+	defer oc.teamsMu.Unlock()
+	if team, ok := oc.teamsBySlug[slug]; ok {
+		return team, oc.teamsResp, oc.teamsErr
 	}
-	return nil, pgGetAllTeamsResponse.resp, err
+	return nil, oc.teamsResp, notFoundOr(oc.teamsErr)
 }
 
-func pgGetTeamByTeamSlug(ctx context.Context, client *github.Client, slug string) (*github.Team, *github.Response, error) {
-	pgInitializeLocalDataTeams(ctx, client)
-	if team, teamFound := pgTeamsByTeamSlug[slug]; teamFound {
-		return team, pgGetAllTeamsResponse.resp, pgGetAllTeamsResponse.err
+// GetRepoByTeamIDAndRepoName bulk-fetches (and caches) every repo of teamID in
+// orgLogin/orgID, then returns the one named repoName. The response and
+// error returned are always the ones captured for this specific teamID's own
+// fetch - never a different team's, even under concurrent lookups.
+func (c *ResourceCache) GetRepoByTeamIDAndRepoName(ctx context.Context, client *github.Client, orgLogin string, orgID, teamID int64, repoName string) (*github.Repository, *github.Response, error) {
+	oc := c.forOrg(orgLogin, orgID)
+	pgInitializeLocalDataTeamRepos(ctx, client, c, oc, teamID)
+	entry := oc.teamRepoEntry(teamID)
+
+	// entry.mu guards the lookup for the same reason oc.teamsMu does above:
+	// ForceRefresh/TTL expiry can re-fetch and overwrite entry.reposByName
+	// concurrently with another goroutine reading it here.
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if repo, ok := entry.reposByName[repoName]; ok {
+		return repo, entry.resp, entry.err
 	}
-	err := pgGetAllTeamsResponse.err
-	if err == nil {
-		err = &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}}
+	return nil, entry.resp, notFoundOr(entry.err)
+}
+
+// GetMemberByLogin bulk-fetches (and caches) every member of orgLogin/orgID,
+// then returns the one matching login.
+func (c *ResourceCache) GetMemberByLogin(ctx context.Context, client *github.Client, orgLogin string, orgID int64, login string) (*github.User, *github.Response, error) {
+	oc := c.forOrg(orgLogin, orgID)
+	pgInitializeLocalDataMembers(ctx, client, c, oc)
+
+	oc.membersMu.Lock()
+	defer oc.membersMu.Unlock()
+	if member, ok := oc.membersByLogin[login]; ok {
+		return member, oc.membersResp, oc.membersErr
 	}
-	return nil, pgGetAllTeamsResponse.resp, err
+	return nil, oc.membersResp, notFoundOr(oc.membersErr)
 }
 
-func pgGetRepoByTeamIDAndRepoName(ctx context.Context, client *github.Client, teamID int64, repoName string) (*github.Repository, *github.Response, error) {
-	pgInitializeLocalDataTeamRepos(ctx, client, teamID)
-	if mapRepoNameToRepo, ok := pgReposByTeamIdAndRepoName.Load(teamID); ok {
-		if repo, repoFound := mapRepoNameToRepo.(map[string]*github.Repository)[repoName]; repoFound {
-			return repo, pgGetAllTeamReposResponse.resp, pgGetAllTeamReposResponse.err
-		}
+// GetTeamMemberByLogin bulk-fetches (and caches) every member of teamID in
+// orgLogin/orgID, then returns the one matching login. As with
+// GetRepoByTeamIDAndRepoName, the response/error are always this teamID's own.
+func (c *ResourceCache) GetTeamMemberByLogin(ctx context.Context, client *github.Client, orgLogin string, orgID, teamID int64, login string) (*github.User, *github.Response, error) {
+	oc := c.forOrg(orgLogin, orgID)
+	pgInitializeLocalDataTeamMembers(ctx, client, c, oc, teamID)
+	entry := oc.teamMemberEntry(teamID)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if member, ok := entry.membersByName[login]; ok {
+		return member, entry.resp, entry.err
 	}
-	err := pgGetAllTeamReposResponse.err
-	if err == nil {
-		err = &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}}
+	return nil, entry.resp, notFoundOr(entry.err)
+}
+
+func notFoundOr(err error) error {
+	if err != nil {
+		return err
 	}
-	return nil, pgGetAllTeamReposResponse.resp, err
+	return &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}}
+}
+
+// pgGetTeamByTeamId, pgGetTeamByTeamSlug, and pgGetRepoByTeamIDAndRepoName
+// below keep the original single-org pg* signatures this file has always
+// exposed, so that wiring them into resource_github_team.go,
+// resource_github_team_repository.go, etc. (not part of this change) is a
+// drop-in replacement rather than a signature change. They delegate to
+// pgResourceCache scoped to the pgGithubOrgName/pgGithubOrgId default, the
+// same org those call sites would use.
+
+func pgGetTeamByTeamId(ctx context.Context, client *github.Client, id int64) (*github.Team, *github.Response, error) {
+	return pgResourceCache.GetTeamByID(ctx, client, pgGithubOrgName, pgGithubOrgId, id)
+}
+
+func pgGetTeamByTeamSlug(ctx context.Context, client *github.Client, slug string) (*github.Team, *github.Response, error) {
+	return pgResourceCache.GetTeamBySlug(ctx, client, pgGithubOrgName, pgGithubOrgId, slug)
+}
+
+func pgGetRepoByTeamIDAndRepoName(ctx context.Context, client *github.Client, teamID int64, repoName string) (*github.Repository, *github.Response, error) {
+	return pgResourceCache.GetRepoByTeamIDAndRepoName(ctx, client, pgGithubOrgName, pgGithubOrgId, teamID, repoName)
+}
+
+// pgGetMemberByLogin and pgGetTeamMemberByLogin are the member/team-membership
+// equivalents, meant for resources such as
+// resource_github_repository_collaborators.go that previously had no bulk
+// cache to hit at all; wiring them in is a follow-up, not part of this file.
+
+func pgGetMemberByLogin(ctx context.Context, client *github.Client, login string) (*github.User, *github.Response, error) {
+	return pgResourceCache.GetMemberByLogin(ctx, client, pgGithubOrgName, pgGithubOrgId, login)
+}
+
+func pgGetTeamMemberByLogin(ctx context.Context, client *github.Client, teamID int64, login string) (*github.User, *github.Response, error) {
+	return pgResourceCache.GetTeamMemberByLogin(ctx, client, pgGithubOrgName, pgGithubOrgId, teamID, login)
 }
@@ -0,0 +1,468 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v66/github"
+	"github.com/gregjones/httpcache"
+)
+
+// TestResourceCacheConcurrentTeamAndRepoFetch drives many concurrent lookups
+// for distinct teams against the same org through ResourceCache. It exists to
+// catch the class of bug this cache used to have when pgGetAllTeamsResponse
+// and pgGetAllTeamReposResponse were package globals overwritten by whichever
+// team's fetch happened to run last: a lookup for one team could observe the
+// response or error captured while fetching a completely different team.
+// Run with `go test -race` to verify there's no data race either.
+func TestResourceCacheConcurrentTeamAndRepoFetch(t *testing.T) {
+	const orgLogin = "acme"
+	const orgID = int64(42)
+	const numTeams = 25
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(fmt.Sprintf("/orgs/%s/teams", orgLogin), func(w http.ResponseWriter, r *http.Request) {
+		teams := make([]*github.Team, numTeams)
+		for i := range teams {
+			id := int64(i + 1)
+			teams[i] = &github.Team{ID: &id, Slug: github.String(fmt.Sprintf("team-%d", id))}
+		}
+		writeJSON(t, w, teams)
+	})
+	mux.HandleFunc(fmt.Sprintf("/organizations/%d/team/", orgID), func(w http.ResponseWriter, r *http.Request) {
+		teamID, err := teamIDFromReposPath(r.URL.Path, orgID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		repos := []*github.Repository{
+			{Name: github.String(repoNameFor(teamID))},
+		}
+		writeJSON(t, w, repos)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = baseURL
+
+	cache := NewResourceCache()
+
+	var wg sync.WaitGroup
+	for i := 0; i < numTeams; i++ {
+		teamID := int64(i + 1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := context.Background()
+
+			team, _, err := cache.GetTeamByID(ctx, client, orgLogin, orgID, teamID)
+			if err != nil {
+				t.Errorf("GetTeamByID(%d): %v", teamID, err)
+				return
+			}
+			if team.GetID() != teamID {
+				t.Errorf("GetTeamByID(%d) returned team %d", teamID, team.GetID())
+			}
+
+			wantRepo := repoNameFor(teamID)
+			repo, _, err := cache.GetRepoByTeamIDAndRepoName(ctx, client, orgLogin, orgID, teamID, wantRepo)
+			if err != nil {
+				t.Errorf("GetRepoByTeamIDAndRepoName(%d): %v", teamID, err)
+				return
+			}
+			if repo.GetName() != wantRepo {
+				t.Errorf("GetRepoByTeamIDAndRepoName(%d) returned repo %q, want %q", teamID, repo.GetName(), wantRepo)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestResourceCacheTeamsPaginationWithoutLastPage exercises the NextPage-based
+// fallback in pgInitializeLocalDataTeams: the server only ever advertises
+// Link: rel="next", never rel="last", so resp.LastPage stays 0 on every page
+// and the errgroup fan-out can't be used. All pages must still be walked and
+// merged, or this regresses to the silent data-loss bug rel="last"-only
+// pagination had.
+func TestResourceCacheTeamsPaginationWithoutLastPage(t *testing.T) {
+	const orgLogin = "acme"
+	const orgID = int64(42)
+	const totalPages = 3
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(fmt.Sprintf("/orgs/%s/teams", orgLogin), func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		id := int64(page)
+		if page < totalPages {
+			w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d>; rel="next"`, r.URL.Path, page+1))
+		}
+		writeJSON(t, w, []*github.Team{{ID: &id, Slug: github.String(fmt.Sprintf("team-%d", id))}})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = baseURL
+
+	cache := NewResourceCache()
+	for wantID := int64(1); wantID <= totalPages; wantID++ {
+		team, _, err := cache.GetTeamByID(context.Background(), client, orgLogin, orgID, wantID)
+		if err != nil {
+			t.Fatalf("GetTeamByID(%d): %v", wantID, err)
+		}
+		if team.GetID() != wantID {
+			t.Errorf("GetTeamByID(%d) returned team %d", wantID, team.GetID())
+		}
+	}
+}
+
+// TestResourceCacheRetriesAfterSecondaryRateLimit verifies rateLimitedDo backs
+// off and retries once when GitHub responds with a secondary (abuse) rate
+// limit error, instead of surfacing the error to the caller immediately.
+func TestResourceCacheRetriesAfterSecondaryRateLimit(t *testing.T) {
+	const orgLogin = "acme"
+	const orgID = int64(42)
+
+	var calls int32
+	mux := http.NewServeMux()
+	mux.HandleFunc(fmt.Sprintf("/orgs/%s/teams", orgLogin), func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusForbidden)
+			writeJSON(t, w, map[string]string{
+				"message":           "You have exceeded a secondary rate limit",
+				"documentation_url": "https://docs.github.com/rest/overview/rate-limits-for-the-rest-api#secondary-rate-limits",
+			})
+			return
+		}
+		id := int64(1)
+		writeJSON(t, w, []*github.Team{{ID: &id, Slug: github.String("team-1")}})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = baseURL
+
+	cache := NewResourceCache()
+	team, _, err := cache.GetTeamByID(context.Background(), client, orgLogin, orgID, 1)
+	if err != nil {
+		t.Fatalf("GetTeamByID(1): %v", err)
+	}
+	if team.GetID() != 1 {
+		t.Errorf("GetTeamByID(1) returned team %d", team.GetID())
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("server saw %d requests, want 2 (one rate-limited, one retry)", got)
+	}
+}
+
+// TestNewCachedHTTPClientReplays304Responses verifies the conditional-GET
+// transport installed by NewCachedHTTPClient short-circuits a second request
+// for an unchanged page into a 304, and that go-github still decodes the
+// cache-replayed body correctly rather than returning it empty.
+func TestNewCachedHTTPClientReplays304Responses(t *testing.T) {
+	const orgLogin = "acme"
+	const etag = `"teams-etag"`
+
+	var fullResponses int32
+	mux := http.NewServeMux()
+	mux.HandleFunc(fmt.Sprintf("/orgs/%s/teams", orgLogin), func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&fullResponses, 1)
+		w.Header().Set("ETag", etag)
+		id := int64(1)
+		writeJSON(t, w, []*github.Team{{ID: &id, Slug: github.String("team-1")}})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cache := NewResourceCache()
+	client := github.NewClient(cache.NewCachedHTTPClient(nil))
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = baseURL
+
+	ctx := context.Background()
+	teams1, resp1, err := client.Teams.ListTeams(ctx, orgLogin, nil)
+	if err != nil {
+		t.Fatalf("first ListTeams: %v", err)
+	}
+	if got := resp1.Header.Get(httpcache.XFromCache); got != "" {
+		t.Errorf("first request was unexpectedly served from cache")
+	}
+
+	teams2, resp2, err := client.Teams.ListTeams(ctx, orgLogin, nil)
+	if err != nil {
+		t.Fatalf("second ListTeams: %v", err)
+	}
+	if got := resp2.Header.Get(httpcache.XFromCache); got == "" {
+		t.Errorf("second request was not served from the conditional-GET cache")
+	}
+	if len(teams2) != 1 || teams2[0].GetID() != teams1[0].GetID() {
+		t.Errorf("second response decoded to %+v, want a copy of %+v", teams2, teams1)
+	}
+	if got := atomic.LoadInt32(&fullResponses); got != 1 {
+		t.Errorf("server sent %d full responses, want 1 (second request should have been a 304)", got)
+	}
+}
+
+// TestResourceCacheForceRefreshAndTTLExpiry covers both halves of chunk0-4:
+// ForceRefresh invalidates on demand regardless of TTL, and once a TTL is
+// configured a lookup past that TTL re-lists from GitHub on its own.
+func TestResourceCacheForceRefreshAndTTLExpiry(t *testing.T) {
+	const orgLogin = "acme"
+	const orgID = int64(42)
+
+	var slug atomic.Value
+	slug.Store("team-1-v1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(fmt.Sprintf("/orgs/%s/teams", orgLogin), func(w http.ResponseWriter, r *http.Request) {
+		id := int64(1)
+		writeJSON(t, w, []*github.Team{{ID: &id, Slug: github.String(slug.Load().(string))}})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = baseURL
+
+	cache := NewResourceCache()
+	cache.SetCacheConfig(CacheConfig{TTL: 20 * time.Millisecond})
+	ctx := context.Background()
+
+	team, _, err := cache.GetTeamByID(ctx, client, orgLogin, orgID, 1)
+	if err != nil {
+		t.Fatalf("GetTeamByID: %v", err)
+	}
+	if team.GetSlug() != "team-1-v1" {
+		t.Fatalf("got slug %q, want team-1-v1", team.GetSlug())
+	}
+
+	slug.Store("team-1-v2")
+
+	// Within the TTL, the stale cached value should still be served.
+	team, _, err = cache.GetTeamByID(ctx, client, orgLogin, orgID, 1)
+	if err != nil {
+		t.Fatalf("GetTeamByID: %v", err)
+	}
+	if team.GetSlug() != "team-1-v1" {
+		t.Errorf("got slug %q before TTL expiry, want stale team-1-v1", team.GetSlug())
+	}
+
+	// ForceRefresh invalidates immediately, regardless of TTL.
+	if err := cache.ForceRefresh(ctx, client, orgLogin, orgID); err != nil {
+		t.Fatalf("ForceRefresh: %v", err)
+	}
+	team, _, err = cache.GetTeamByID(ctx, client, orgLogin, orgID, 1)
+	if err != nil {
+		t.Fatalf("GetTeamByID: %v", err)
+	}
+	if team.GetSlug() != "team-1-v2" {
+		t.Errorf("got slug %q after ForceRefresh, want team-1-v2", team.GetSlug())
+	}
+
+	slug.Store("team-1-v3")
+	time.Sleep(30 * time.Millisecond)
+
+	// Past the TTL, a lookup re-lists on its own without ForceRefresh.
+	team, _, err = cache.GetTeamByID(ctx, client, orgLogin, orgID, 1)
+	if err != nil {
+		t.Fatalf("GetTeamByID: %v", err)
+	}
+	if team.GetSlug() != "team-1-v3" {
+		t.Errorf("got slug %q after TTL expiry, want team-1-v3", team.GetSlug())
+	}
+}
+
+// TestResourceCacheStartBackgroundRefresh verifies the background refresh
+// goroutine actually re-lists on its own ticker, without any caller invoking
+// ForceRefresh or GetTeamByID in between.
+func TestResourceCacheStartBackgroundRefresh(t *testing.T) {
+	const orgLogin = "acme"
+	const orgID = int64(42)
+
+	var slug atomic.Value
+	slug.Store("team-1-v1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(fmt.Sprintf("/orgs/%s/teams", orgLogin), func(w http.ResponseWriter, r *http.Request) {
+		id := int64(1)
+		writeJSON(t, w, []*github.Team{{ID: &id, Slug: github.String(slug.Load().(string))}})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = baseURL
+
+	cache := NewResourceCache()
+	cache.SetCacheConfig(CacheConfig{TTL: time.Hour, SyncInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, _, err := cache.GetTeamByID(ctx, client, orgLogin, orgID, 1); err != nil {
+		t.Fatalf("GetTeamByID: %v", err)
+	}
+
+	cache.StartBackgroundRefresh(ctx, client)
+	slug.Store("team-1-v2")
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		cache.forOrg(orgLogin, orgID).teamsMu.Lock()
+		team := cache.forOrg(orgLogin, orgID).teamsByID[1]
+		cache.forOrg(orgLogin, orgID).teamsMu.Unlock()
+		if team.GetSlug() == "team-1-v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("background refresh never observed the updated slug; last seen %q", team.GetSlug())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestResourceCacheConcurrentLookupsDuringBackgroundRefresh drives GetTeamByID
+// and GetRepoByTeamIDAndRepoName from many goroutines while a short TTL and
+// background refresh keep re-fetching and overwriting the underlying maps at
+// the same time. GetTeamByID/GetRepoByTeamIDAndRepoName used to read
+// oc.teamsByID/entry.reposByName (and the paired resp/err fields) after
+// pgInitializeLocalDataTeams/pgInitializeLocalDataTeamRepos had already
+// released the mutex guarding them, which is harmless with the TTL-less
+// single-write default but a data race as soon as TTL/ForceRefresh make
+// writes recur - run with `go test -race` to catch it.
+func TestResourceCacheConcurrentLookupsDuringBackgroundRefresh(t *testing.T) {
+	const orgLogin = "acme"
+	const orgID = int64(42)
+	const teamID = int64(1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(fmt.Sprintf("/orgs/%s/teams", orgLogin), func(w http.ResponseWriter, r *http.Request) {
+		id := teamID
+		writeJSON(t, w, []*github.Team{{ID: &id, Slug: github.String("team-1")}})
+	})
+	mux.HandleFunc(fmt.Sprintf("/organizations/%d/team/", orgID), func(w http.ResponseWriter, r *http.Request) {
+		id, err := teamIDFromReposPath(r.URL.Path, orgID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(t, w, []*github.Repository{{Name: github.String(repoNameFor(id))}})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = baseURL
+
+	cache := NewResourceCache()
+	cache.SetCacheConfig(CacheConfig{TTL: time.Millisecond, SyncInterval: time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache.StartBackgroundRefresh(ctx, client)
+
+	const numWorkers = 20
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(100 * time.Millisecond)
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				if _, _, err := cache.GetTeamByID(ctx, client, orgLogin, orgID, teamID); err != nil {
+					t.Errorf("GetTeamByID: %v", err)
+					return
+				}
+				wantRepo := repoNameFor(teamID)
+				repo, _, err := cache.GetRepoByTeamIDAndRepoName(ctx, client, orgLogin, orgID, teamID, wantRepo)
+				if err != nil {
+					t.Errorf("GetRepoByTeamIDAndRepoName: %v", err)
+					return
+				}
+				if repo.GetName() != wantRepo {
+					t.Errorf("GetRepoByTeamIDAndRepoName returned repo %q, want %q", repo.GetName(), wantRepo)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func repoNameFor(teamID int64) string {
+	return fmt.Sprintf("repo-%d", teamID)
+}
+
+// teamIDFromReposPath parses the team ID out of a
+// "/organizations/{orgID}/team/{teamID}/repos" request path.
+func teamIDFromReposPath(path string, orgID int64) (int64, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 5 || parts[0] != "organizations" || parts[2] != "team" || parts[4] != "repos" {
+		return 0, fmt.Errorf("unexpected path %q", path)
+	}
+	if parts[1] != strconv.FormatInt(orgID, 10) {
+		return 0, fmt.Errorf("unexpected org ID in path %q", path)
+	}
+	return strconv.ParseInt(parts[3], 10, 64)
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v any) {
+	t.Helper()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+}